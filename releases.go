@@ -1,8 +1,12 @@
 package empire
 
 import (
-	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	storagedriver "github.com/remind101/empire/storage/driver"
 )
 
 // ReleaseID represents the unique identifier for a Release.
@@ -26,135 +30,341 @@ func (r ReleaseID) Value() (driver.Value, error) {
 // release.
 type ReleaseVersion int
 
+// ReleaseStatus represents the lifecycle state of a Release as it moves from
+// being created to being scheduled onto the cluster.
+type ReleaseStatus string
+
+const (
+	// ReleaseStatusPending means the release has been created but hasn't
+	// yet been confirmed as scheduled.
+	ReleaseStatusPending ReleaseStatus = "pending"
+	// ReleaseStatusDeployed means the release's formation has converged
+	// on the cluster.
+	ReleaseStatusDeployed ReleaseStatus = "deployed"
+	// ReleaseStatusFailed means scheduling the release's formation
+	// failed.
+	ReleaseStatusFailed ReleaseStatus = "failed"
+	// ReleaseStatusSuperseded means a newer release has since been
+	// created for the app.
+	ReleaseStatusSuperseded ReleaseStatus = "superseded"
+)
+
 // Release is a combination of a Config and a Slug, which form a deployable
 // release.
 type Release struct {
-	ID  ReleaseID      `json:"id" db:"id"`
-	Ver ReleaseVersion `json:"version" db:"version"` // Version conflicts with gorps optimistic locking.
+	ID     ReleaseID      `json:"id" db:"id"`
+	Ver    ReleaseVersion `json:"version" db:"version"` // Version conflicts with gorps optimistic locking.
+	Status ReleaseStatus  `json:"status" db:"status"`
 
 	AppName  `json:"-" db:"app_id"`
 	ConfigID `json:"-" db:"config_id"`
 	SlugID   `json:"-" db:"slug_id"`
 }
 
+// ProcessHealth is the last-known health of a single process type belonging
+// to a Release, as reported by Manager.
+type ProcessHealth struct {
+	Type   ProcessType `json:"type"`
+	Status string      `json:"status"`
+}
+
+// ReleaseState describes the current status of a Release, together with the
+// last-known health of each of its processes.
+type ReleaseState struct {
+	Status    ReleaseStatus   `json:"status"`
+	Processes []ProcessHealth `json:"processes"`
+}
+
 // ReleaseRepository is an interface that can be implemented for storing and
 // retrieving releases.
 type ReleasesRepository interface {
 	Create(*Release) (*Release, error)
 	FindByAppName(AppName) ([]*Release, error)
+	FindPending() ([]*Release, error)
+	Get(AppName, ReleaseVersion) (*Release, error)
 	Head(AppName) (*Release, error)
+	Update(*Release) (*Release, error)
 }
 
-// NewReleasesRepository is a factory method that returns a new Repository.
-func NewReleasesRepository(db DB) (ReleasesRepository, error) {
-	return &releasesRepository{db}, nil
+// NewReleasesRepository is a factory method that returns a new Repository
+// backed by Postgres. Use NewReleasesRepositoryWithDriver to plug in an
+// alternate storage.driver.Driver, such as storage/driver.MemoryDriver. A nil
+// logger discards all log events.
+func NewReleasesRepository(db DB, logger Logger) (ReleasesRepository, error) {
+	return NewReleasesRepositoryWithDriver(storagedriver.NewSQLDriver(sqlDriverDB{db}), logger)
+}
+
+// sqlDriverDB adapts empire's DB type to the storagedriver.DB interface
+// SQLDriver requires. DB already satisfies storagedriver.DB's Select,
+// SelectOne and Update directly; the only wrinkle is Begin, whose return
+// type needs adapting to storagedriver.Transaction.
+type sqlDriverDB struct {
+	DB
 }
 
-// dbRelease is a db representation of a release.
-type dbRelease struct {
-	ID       *string `db:"id"`
-	Ver      int64   `db:"version"` // Ver because Version is reserved in gorp for optimistic locking.
-	AppID    string  `db:"app_id"`
-	ConfigID string  `db:"config_id"`
-	SlugID   string  `db:"slug_id"`
+func (d sqlDriverDB) Begin() (storagedriver.Transaction, error) {
+	return d.DB.Begin()
 }
 
-// releasesRepository is an implementation of the ReleasesRepository interface backed by
-// a DB.
+// NewReleasesRepositoryWithDriver returns a new Repository backed by d. This
+// is the extension point that lets tests and embedded deployments swap the
+// Postgres-backed driver for storagedriver.MemoryDriver. A nil logger
+// discards all log events.
+func NewReleasesRepositoryWithDriver(d storagedriver.Driver, logger Logger) (ReleasesRepository, error) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+
+	return &releasesRepository{driver: d, Logger: logger}, nil
+}
+
+// releasesRepository is an implementation of the ReleasesRepository
+// interface that delegates storage to a storagedriver.Driver.
 type releasesRepository struct {
-	DB
+	driver storagedriver.Driver
+	Logger
 }
 
 func (r *releasesRepository) Create(release *Release) (*Release, error) {
-	return CreateRelease(r.DB, release)
+	dr, err := r.driver.Create(toDriverRelease(release))
+	if err != nil {
+		return fromDriverRelease(dr), err
+	}
+
+	r.Log("creating release v%d for %s", dr.Version, dr.AppID)
+
+	return fromDriverRelease(dr), nil
 }
 
 func (r *releasesRepository) Head(appName AppName) (*Release, error) {
-	return LastRelease(r.DB, appName)
-}
+	dr, err := r.driver.Last(string(appName))
+	if err != nil {
+		return nil, err
+	}
 
-func (r *releasesRepository) FindByAppName(appName AppName) ([]*Release, error) {
-	var rs []*Release
-	return rs, r.DB.Select(&rs, `select * from releases where app_id = $1 order by version desc limit 1`, string(appName))
+	return fromDriverRelease(dr), nil
 }
 
-// CreateRelease creates a new Release and inserts it into the database.
-func CreateRelease(db DB, release *Release) (*Release, error) {
-	t, err := db.Begin()
+// FindByAppName returns the full release history for an app, in descending
+// version order (most recent first).
+func (r *releasesRepository) FindByAppName(appName AppName) ([]*Release, error) {
+	drs, err := r.driver.History(string(appName))
 	if err != nil {
-		return release, err
+		return nil, err
 	}
 
-	// Get the last release version for this app.
-	v, err := LastReleaseVersion(t, release.AppName)
+	return fromDriverReleases(drs), nil
+}
+
+// Get finds a specific Release belonging to an app by its version number.
+func (r *releasesRepository) Get(appName AppName, version ReleaseVersion) (*Release, error) {
+	dr, err := r.driver.Get(string(appName), int64(version))
 	if err != nil {
-		return release, err
+		return nil, err
 	}
 
-	// Increment the release version.
-	release.Ver = v + 1
+	return fromDriverRelease(dr), nil
+}
 
-	if err := t.Insert(release); err != nil {
-		return release, err
+// FindPending returns every Release that hasn't yet reached a terminal
+// status, so the reconciler knows what to poll Manager about.
+func (r *releasesRepository) FindPending() ([]*Release, error) {
+	drs, err := r.driver.Pending(string(ReleaseStatusPending))
+	if err != nil {
+		return nil, err
 	}
 
-	return release, t.Commit()
+	return fromDriverReleases(drs), nil
 }
 
-// LastReleaseVersion returns the last ReleaseVersion for the given App. This
-// function also ensures that the last release is locked until the transaction
-// is commited, so the release version can be incremented atomically.
-func LastReleaseVersion(db Queryier, appName AppName) (version ReleaseVersion, err error) {
-	err = db.SelectOne(&version, `select version from releases where app_id = $1 order by version desc for update`, string(appName))
+// Update persists changes made to a Release, such as its Status.
+func (r *releasesRepository) Update(release *Release) (*Release, error) {
+	dr, err := r.driver.Update(toDriverRelease(release))
+	return fromDriverRelease(dr), err
+}
 
-	if err == sql.ErrNoRows {
-		return 0, nil
+// toDriverRelease converts a Release into its storage.driver representation.
+func toDriverRelease(release *Release) *storagedriver.Release {
+	return &storagedriver.Release{
+		ID:       string(release.ID),
+		Version:  int64(release.Ver),
+		AppID:    string(release.AppName),
+		ConfigID: string(release.ConfigID),
+		SlugID:   string(release.SlugID),
+		Status:   string(release.Status),
 	}
-
-	return
 }
 
-// LastRelease returns the last Release for the given App.
-func LastRelease(db Queryier, appName AppName) (*Release, error) {
-	var release Release
+// fromDriverRelease converts a storage.driver Release back into a Release.
+func fromDriverRelease(dr *storagedriver.Release) *Release {
+	if dr == nil {
+		return nil
+	}
 
-	if err := db.SelectOne(&release, `select * from releases where app_id = $1 order by version desc limit 1`, string(appName)); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
+	return &Release{
+		ID:       ReleaseID(dr.ID),
+		Ver:      ReleaseVersion(dr.Version),
+		Status:   ReleaseStatus(dr.Status),
+		AppName:  AppName(dr.AppID),
+		ConfigID: ConfigID(dr.ConfigID),
+		SlugID:   SlugID(dr.SlugID),
+	}
+}
 
-		return nil, err
+func fromDriverReleases(drs []*storagedriver.Release) []*Release {
+	rs := make([]*Release, len(drs))
+	for i, dr := range drs {
+		rs[i] = fromDriverRelease(dr)
 	}
 
-	return &release, nil
+	return rs
 }
 
+// ErrReleaseNotFound is returned by Rollback and Status when the requested
+// version doesn't exist for an app. Get returns a nil Release and no error
+// in that case.
+var ErrReleaseNotFound = errors.New("empire: release not found")
+
+// Logger is implemented by types that can record progress events emitted
+// during the release lifecycle, so a deploy that hangs in
+// Manager.ScheduleRelease or during version allocation can be debugged from
+// the logs rather than producing no diagnostic output at all.
+type Logger interface {
+	Log(format string, args ...interface{})
+}
+
+// nopLogger is the Logger used when none is provided.
+type nopLogger struct{}
+
+func (nopLogger) Log(format string, args ...interface{}) {}
+
 // ReleaseesService represents a service for interacting with Releases.
 type ReleasesService interface {
 	// Create creates a new release.
 	Create(*App, *Config, *Slug) (*Release, error)
 
+	// Rollback creates a new release that reuses the Config, Slug and
+	// process formation from a prior release.
+	Rollback(*App, ReleaseVersion) (*Release, error)
+
 	// Find existing releases for an app
 	FindByApp(*App) ([]*Release, error)
 
+	// Find a specific release for an app, by version.
+	Get(*App, ReleaseVersion) (*Release, error)
+
 	// Find current release for an app
 	Head(*App) (*Release, error)
+
+	// Status returns the current status of a release, along with the
+	// last-known health of its processes.
+	Status(*App, ReleaseVersion) (*ReleaseState, error)
 }
 
+// DefaultReconcileInterval is how often releasesService polls Manager for
+// the actual scheduled state of pending releases.
+const DefaultReconcileInterval = 10 * time.Second
+
 // releasesService is a base implementation of the ReleasesService interface.
 type releasesService struct {
 	ReleasesRepository
+	ConfigsRepository
+	SlugsRepository
 	ProcessesRepository
 	Manager
+	Logger
+
+	mu     sync.Mutex
+	health map[ReleaseID][]ProcessHealth
+
+	stopReconciler chan struct{}
 }
 
-// NewReleasesService returns a new ReleasesService instance.
-func NewReleasesService(r ReleasesRepository, p ProcessesRepository, m Manager) (ReleasesService, error) {
-	return &releasesService{
+// NewReleasesService returns a new ReleasesService instance, and starts its
+// background reconciler at DefaultReconcileInterval. A nil logger discards
+// all log events.
+func NewReleasesService(r ReleasesRepository, c ConfigsRepository, sl SlugsRepository, p ProcessesRepository, m Manager, logger Logger) (ReleasesService, error) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+
+	s := &releasesService{
 		ReleasesRepository:  r,
+		ConfigsRepository:   c,
+		SlugsRepository:     sl,
 		ProcessesRepository: p,
 		Manager:             m,
-	}, nil
+		Logger:              logger,
+		health:              make(map[ReleaseID][]ProcessHealth),
+	}
+
+	s.stopReconciler = s.StartReconciler(DefaultReconcileInterval)
+
+	return s, nil
+}
+
+// StartReconciler launches a background loop that polls Manager for the
+// actual scheduled state of every pending release every interval, and
+// updates the release's Status in the database accordingly. The returned
+// channel can be closed to stop the loop.
+func (s *releasesService) StartReconciler(interval time.Duration) chan struct{} {
+	stop := make(chan struct{})
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				s.reconcile()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// reconcile polls Manager for the actual state of every pending release and
+// persists the result. It requires Manager to implement:
+//
+//	ReleaseStatus(*Release) (ReleaseStatus, []ProcessHealth, error)
+//
+// alongside the ScheduleRelease method Create and Rollback already depend
+// on.
+func (s *releasesService) reconcile() {
+	pending, err := s.ReleasesRepository.FindPending()
+	if err != nil {
+		s.Log("reconcile: finding pending releases: %v", err)
+		return
+	}
+
+	for _, release := range pending {
+		status, processes, err := s.Manager.ReleaseStatus(release)
+		if err != nil {
+			s.Log("reconcile: getting status for %s v%d: %v", release.AppName, release.Ver, err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.health[release.ID] = processes
+		s.mu.Unlock()
+
+		if status == release.Status {
+			continue
+		}
+
+		release.Status = status
+
+		if _, err := s.ReleasesRepository.Update(release); err != nil {
+			s.Log("reconcile: updating status for %s v%d: %v", release.AppName, release.Ver, err)
+			continue
+		}
+
+		s.Log("release %s v%d status changed to %s", release.AppName, release.Ver, release.Status)
+	}
 }
 
 // Create creates the release, then sets the current process formation on the release.
@@ -163,6 +373,7 @@ func (s *releasesService) Create(app *App, config *Config, slug *Slug) (*Release
 		AppName:  app.Name,
 		ConfigID: config.ID,
 		SlugID:   slug.ID,
+		Status:   ReleaseStatusPending,
 	}
 
 	r, err := s.ReleasesRepository.Create(r)
@@ -170,17 +381,98 @@ func (s *releasesService) Create(app *App, config *Config, slug *Slug) (*Release
 		return r, err
 	}
 
+	// Get the old release, so we can copy the Formation.
+	last, err := s.ReleasesRepository.Get(r.AppName, r.Ver-1)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing Formation
+
+	if last != nil {
+		s.Log("copying formation from v%d", last.Ver)
+
+		existing, err = s.ProcessesRepository.All(last.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a new formation for this release.
-	formation, err := s.createFormation(r, slug)
+	formation, err := s.createFormation(r, existing, slug)
 	if err != nil {
 		return nil, err
 	}
 
+	s.Log("scheduling %d processes", len(formation))
+
 	// Schedule the new release onto the cluster.
 	if err := s.Manager.ScheduleRelease(r, config, slug, formation); err != nil {
 		return r, err
 	}
 
+	s.Log("release %s v%d committed", r.AppName, r.Ver)
+
+	return r, nil
+}
+
+// Rollback creates a new release for app that reuses the Config, Slug and
+// process formation of a previously deployed release, then schedules it the
+// same way Create does. This mirrors the workflow `helm rollback` exposes
+// for reverting to a prior release.
+func (s *releasesService) Rollback(app *App, version ReleaseVersion) (*Release, error) {
+	target, err := s.ReleasesRepository.Get(app.Name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if target == nil {
+		return nil, ErrReleaseNotFound
+	}
+
+	config, err := s.ConfigsRepository.Find(target.ConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	slug, err := s.SlugsRepository.Find(target.SlugID)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Release{
+		AppName:  app.Name,
+		ConfigID: target.ConfigID,
+		SlugID:   target.SlugID,
+		Status:   ReleaseStatusPending,
+	}
+
+	r, err = s.ReleasesRepository.Create(r)
+	if err != nil {
+		return r, err
+	}
+
+	s.Log("copying formation from v%d", target.Ver)
+
+	// Copy the formation from the release we're rolling back to.
+	existing, err := s.ProcessesRepository.All(target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	formation, err := s.createFormation(r, existing, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log("scheduling %d processes", len(formation))
+
+	if err := s.Manager.ScheduleRelease(r, config, slug, formation); err != nil {
+		return r, err
+	}
+
+	s.Log("release %s v%d committed", r.AppName, r.Ver)
+
 	return r, nil
 }
 
@@ -188,26 +480,41 @@ func (s *releasesService) FindByApp(a *App) ([]*Release, error) {
 	return s.ReleasesRepository.FindByAppName(a.Name)
 }
 
+func (s *releasesService) Get(app *App, version ReleaseVersion) (*Release, error) {
+	return s.ReleasesRepository.Get(app.Name, version)
+}
+
 func (s *releasesService) Head(app *App) (*Release, error) {
 	return s.ReleasesRepository.Head(app.Name)
 }
 
-func (s *releasesService) createFormation(release *Release, slug *Slug) (Formation, error) {
-	// Get the old release, so we can copy the Formation.
-	last, err := s.ReleasesRepository.Head(release.AppName)
+// Status returns the current status of a release, along with the
+// last-known health of its processes, so operators can tell whether a
+// release actually converged on the cluster.
+func (s *releasesService) Status(app *App, version ReleaseVersion) (*ReleaseState, error) {
+	release, err := s.ReleasesRepository.Get(app.Name, version)
 	if err != nil {
 		return nil, err
 	}
 
-	var existing Formation
-
-	if last != nil {
-		existing, err = s.ProcessesRepository.All(last.ID)
-		if err != nil {
-			return nil, err
-		}
+	if release == nil {
+		return nil, ErrReleaseNotFound
 	}
 
+	s.mu.Lock()
+	processes := s.health[release.ID]
+	s.mu.Unlock()
+
+	return &ReleaseState{
+		Status:    release.Status,
+		Processes: processes,
+	}, nil
+}
+
+// createFormation builds a new Formation for release from existing (the
+// Formation of whichever release it's being copied from) and slug's process
+// types, persisting each process.
+func (s *releasesService) createFormation(release *Release, existing Formation, slug *Slug) (Formation, error) {
 	f := NewFormation(existing, slug.ProcessTypes)
 
 	for _, p := range f {
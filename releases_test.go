@@ -0,0 +1,271 @@
+package empire
+
+import (
+	"sync"
+	"testing"
+
+	storagedriver "github.com/remind101/empire/storage/driver"
+)
+
+func newTestReleasesRepository(t *testing.T) ReleasesRepository {
+	t.Helper()
+
+	r, err := NewReleasesRepositoryWithDriver(storagedriver.NewMemoryDriver(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestReleasesRepository_CreateAssignsVersion(t *testing.T) {
+	r := newTestReleasesRepository(t)
+
+	rel, err := r.Create(&Release{AppName: AppName("acme-inc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rel.Ver != 1 {
+		t.Errorf("expected version 1, got %d", rel.Ver)
+	}
+
+	rel2, err := r.Create(&Release{AppName: AppName("acme-inc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rel2.Ver != 2 {
+		t.Errorf("expected version 2, got %d", rel2.Ver)
+	}
+}
+
+func TestReleasesRepository_FindByAppNameOrder(t *testing.T) {
+	r := newTestReleasesRepository(t)
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Create(&Release{AppName: AppName("acme-inc")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := r.FindByAppName(AppName("acme-inc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("expected 3 releases, got %d", len(history))
+	}
+
+	for i, rel := range history {
+		want := ReleaseVersion(3 - i)
+		if rel.Ver != want {
+			t.Errorf("history[%d]: expected version %d, got %d", i, want, rel.Ver)
+		}
+	}
+}
+
+func TestReleasesRepository_Get(t *testing.T) {
+	r := newTestReleasesRepository(t)
+
+	if _, err := r.Create(&Release{AppName: AppName("acme-inc")}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.Get(AppName("acme-inc"), ReleaseVersion(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got == nil {
+		t.Fatal("expected to find version 1")
+	}
+
+	missing, err := r.Get(AppName("acme-inc"), ReleaseVersion(99))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if missing != nil {
+		t.Fatalf("expected no release for version 99, got %#v", missing)
+	}
+}
+
+func TestReleasesRepository_FindPendingAndUpdate(t *testing.T) {
+	r := newTestReleasesRepository(t)
+
+	rel, err := r.Create(&Release{AppName: AppName("acme-inc"), Status: ReleaseStatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := r.FindPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending release, got %d", len(pending))
+	}
+
+	rel.Status = ReleaseStatusDeployed
+	if _, err := r.Update(rel); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = r.FindPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending releases after update, got %d", len(pending))
+	}
+}
+
+type fakeConfigsRepository struct{}
+
+func (fakeConfigsRepository) Find(ConfigID) (*Config, error) { return nil, nil }
+
+type fakeSlugsRepository struct{}
+
+func (fakeSlugsRepository) Find(SlugID) (*Slug, error) { return nil, nil }
+
+type fakeProcessesRepository struct{}
+
+func (fakeProcessesRepository) All(ReleaseID) (Formation, error) { return nil, nil }
+
+func (fakeProcessesRepository) Create(p *Process) (*Process, error) { return p, nil }
+
+// fakeManager is a Manager that never schedules anything, and reports
+// whatever status tests configure for a release's ID.
+type fakeManager struct {
+	mu       sync.Mutex
+	statuses map[ReleaseID]ReleaseStatus
+}
+
+func newFakeManager() *fakeManager {
+	return &fakeManager{statuses: make(map[ReleaseID]ReleaseStatus)}
+}
+
+func (m *fakeManager) ScheduleRelease(*Release, *Config, *Slug, Formation) error {
+	return nil
+}
+
+func (m *fakeManager) ReleaseStatus(r *Release) (ReleaseStatus, []ProcessHealth, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, ok := m.statuses[r.ID]
+	if !ok {
+		status = r.Status
+	}
+
+	return status, []ProcessHealth{{Type: ProcessType("web"), Status: string(status)}}, nil
+}
+
+func newTestReleasesService(t *testing.T, m *fakeManager) *releasesService {
+	t.Helper()
+
+	r := newTestReleasesRepository(t)
+
+	s, err := NewReleasesService(r, fakeConfigsRepository{}, fakeSlugsRepository{}, fakeProcessesRepository{}, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := s.(*releasesService)
+	t.Cleanup(func() { close(rs.stopReconciler) })
+
+	return rs
+}
+
+func TestReleasesService_ReconcileUpdatesStatus(t *testing.T) {
+	m := newFakeManager()
+	s := newTestReleasesService(t, m)
+
+	rel, err := s.ReleasesRepository.Create(&Release{AppName: AppName("acme-inc"), Status: ReleaseStatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.statuses[rel.ID] = ReleaseStatusDeployed
+
+	s.reconcile()
+
+	got, err := s.ReleasesRepository.Get(rel.AppName, rel.Ver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Status != ReleaseStatusDeployed {
+		t.Errorf("expected status %s, got %s", ReleaseStatusDeployed, got.Status)
+	}
+}
+
+func TestReleasesService_ReconcileSkipsUnchangedStatus(t *testing.T) {
+	m := newFakeManager()
+	s := newTestReleasesService(t, m)
+
+	rel, err := s.ReleasesRepository.Create(&Release{AppName: AppName("acme-inc"), Status: ReleaseStatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.statuses[rel.ID] = ReleaseStatusPending
+
+	s.reconcile()
+
+	pending, err := s.ReleasesRepository.FindPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 1 {
+		t.Fatalf("expected release to remain pending, got %d pending releases", len(pending))
+	}
+}
+
+func TestReleasesService_Status(t *testing.T) {
+	m := newFakeManager()
+	s := newTestReleasesService(t, m)
+
+	rel, err := s.ReleasesRepository.Create(&Release{AppName: AppName("acme-inc"), Status: ReleaseStatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.statuses[rel.ID] = ReleaseStatusDeployed
+	s.reconcile()
+
+	state, err := s.Status(&App{Name: AppName("acme-inc")}, rel.Ver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Status != ReleaseStatusDeployed {
+		t.Errorf("expected status %s, got %s", ReleaseStatusDeployed, state.Status)
+	}
+
+	if len(state.Processes) != 1 {
+		t.Errorf("expected 1 process health entry, got %d", len(state.Processes))
+	}
+}
+
+func TestDriverReleaseRoundTrip(t *testing.T) {
+	rel := &Release{
+		ID:       ReleaseID("r1"),
+		Ver:      ReleaseVersion(3),
+		Status:   ReleaseStatusDeployed,
+		AppName:  AppName("acme-inc"),
+		ConfigID: ConfigID("c1"),
+		SlugID:   SlugID("s1"),
+	}
+
+	got := fromDriverRelease(toDriverRelease(rel))
+
+	if *got != *rel {
+		t.Errorf("expected round trip to preserve the release, got %#v, want %#v", got, rel)
+	}
+}
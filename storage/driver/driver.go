@@ -0,0 +1,73 @@
+// Package driver defines the storage backend interface for persisting
+// releases, modeled after the driver registry Helm's tiller uses to swap
+// between ConfigMap, Secret, and SQL backed release storage.
+package driver
+
+import "fmt"
+
+// Driver names, for selecting a backend from configuration (e.g. a
+// --storage flag).
+const (
+	SQLDriverName    = "sql"
+	MemoryDriverName = "memory"
+)
+
+// NewDriver constructs the named Driver. db is only used by SQLDriverName;
+// it's ignored for MemoryDriverName.
+func NewDriver(name string, db DB) (Driver, error) {
+	switch name {
+	case SQLDriverName:
+		return NewSQLDriver(db), nil
+	case MemoryDriverName:
+		return NewMemoryDriver(), nil
+	default:
+		return nil, fmt.Errorf("driver: unknown driver %q", name)
+	}
+}
+
+// Release is the storage-layer representation of a release. It's
+// intentionally decoupled from empire's Release domain type so that drivers
+// don't need to import package empire.
+type Release struct {
+	ID       string `db:"id"`
+	Version  int64  `db:"version"`
+	AppID    string `db:"app_id"`
+	ConfigID string `db:"config_id"`
+	SlugID   string `db:"slug_id"`
+	Status   string `db:"status"`
+}
+
+// Driver is the interface that a release storage backend must implement.
+// Implementations are keyed by (AppID, Version).
+type Driver interface {
+	// Create persists a new release, allocating its next Version for
+	// AppID, and returns the stored release.
+	Create(*Release) (*Release, error)
+
+	// Get returns the release for AppID at the given Version, or nil if
+	// it doesn't exist.
+	Get(appID string, version int64) (*Release, error)
+
+	// List returns every stored release for which filter returns true.
+	// A nil filter returns every release.
+	List(filter func(*Release) bool) ([]*Release, error)
+
+	// Pending returns every release whose Status equals status; the
+	// reconciler passes the pending status to find releases that haven't
+	// yet reached a terminal status. Implementations should push this
+	// down to storage rather than filtering List's full result set, since
+	// it's polled
+	// frequently by the reconciler.
+	Pending(status string) ([]*Release, error)
+
+	// History returns every release for AppID, in descending Version
+	// order.
+	History(appID string) ([]*Release, error)
+
+	// Last returns the most recent release for AppID, or nil if it has
+	// none.
+	Last(appID string) (*Release, error)
+
+	// Update persists changes to an existing release and returns it.
+	Update(*Release) (*Release, error)
+}
@@ -0,0 +1,119 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryDriver is an in-memory Driver implementation. It's useful for unit
+// tests and for running empire without a database.
+type MemoryDriver struct {
+	mu       sync.RWMutex
+	releases map[string]*Release
+	versions map[string]int64
+}
+
+// NewMemoryDriver returns a new, empty MemoryDriver.
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{
+		releases: make(map[string]*Release),
+		versions: make(map[string]int64),
+	}
+}
+
+func memoryKey(appID string, version int64) string {
+	return fmt.Sprintf("%s/%d", appID, version)
+}
+
+func (d *MemoryDriver) Create(r *Release) (*Release, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.versions[r.AppID]++
+	r.Version = d.versions[r.AppID]
+
+	if r.ID == "" {
+		r.ID = memoryKey(r.AppID, r.Version)
+	}
+
+	cp := *r
+	d.releases[memoryKey(r.AppID, r.Version)] = &cp
+
+	return &cp, nil
+}
+
+func (d *MemoryDriver) Get(appID string, version int64) (*Release, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	r, ok := d.releases[memoryKey(appID, version)]
+	if !ok {
+		return nil, nil
+	}
+
+	cp := *r
+	return &cp, nil
+}
+
+func (d *MemoryDriver) List(filter func(*Release) bool) ([]*Release, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var rs []*Release
+	for _, r := range d.releases {
+		if filter == nil || filter(r) {
+			cp := *r
+			rs = append(rs, &cp)
+		}
+	}
+
+	return rs, nil
+}
+
+func (d *MemoryDriver) Pending(status string) ([]*Release, error) {
+	return d.List(func(r *Release) bool {
+		return r.Status == status
+	})
+}
+
+func (d *MemoryDriver) History(appID string) ([]*Release, error) {
+	rs, err := d.List(func(r *Release) bool {
+		return r.AppID == appID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Version > rs[j].Version })
+
+	return rs, nil
+}
+
+func (d *MemoryDriver) Last(appID string) (*Release, error) {
+	rs, err := d.History(appID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs) == 0 {
+		return nil, nil
+	}
+
+	return rs[0], nil
+}
+
+func (d *MemoryDriver) Update(r *Release) (*Release, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := memoryKey(r.AppID, r.Version)
+	if _, ok := d.releases[k]; !ok {
+		return nil, fmt.Errorf("driver: release %s not found", k)
+	}
+
+	cp := *r
+	d.releases[k] = &cp
+
+	return &cp, nil
+}
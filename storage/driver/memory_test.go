@@ -0,0 +1,147 @@
+package driver
+
+import "testing"
+
+func TestMemoryDriver_Create(t *testing.T) {
+	d := NewMemoryDriver()
+
+	r, err := d.Create(&Release{AppID: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Version != 1 {
+		t.Errorf("expected version 1, got %d", r.Version)
+	}
+
+	if r.ID == "" {
+		t.Error("expected Create to assign an ID")
+	}
+
+	r2, err := d.Create(&Release{AppID: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r2.Version != 2 {
+		t.Errorf("expected version 2, got %d", r2.Version)
+	}
+
+	if r2.ID == r.ID {
+		t.Error("expected distinct releases to get distinct IDs")
+	}
+}
+
+func TestMemoryDriver_GetAndLast(t *testing.T) {
+	d := NewMemoryDriver()
+
+	if _, err := d.Create(&Release{AppID: "acme-inc", Status: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Create(&Release{AppID: "acme-inc", Status: "deployed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.Get("acme-inc", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got == nil || got.Version != 1 {
+		t.Fatalf("expected to find version 1, got %#v", got)
+	}
+
+	if _, err := d.Get("acme-inc", 99); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := d.Last("acme-inc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last == nil || last.Version != 2 {
+		t.Fatalf("expected last version to be 2, got %#v", last)
+	}
+}
+
+func TestMemoryDriver_History(t *testing.T) {
+	d := NewMemoryDriver()
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.Create(&Release{AppID: "acme-inc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := d.Create(&Release{AppID: "other-app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := d.History("acme-inc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("expected 3 releases in history, got %d", len(history))
+	}
+
+	for i, r := range history {
+		want := int64(3 - i)
+		if r.Version != want {
+			t.Errorf("history[%d]: expected version %d, got %d", i, want, r.Version)
+		}
+	}
+}
+
+func TestMemoryDriver_PendingAndUpdate(t *testing.T) {
+	d := NewMemoryDriver()
+
+	r, err := d.Create(&Release{AppID: "acme-inc", Status: "pending"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Create(&Release{AppID: "acme-inc", Status: "deployed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := d.Pending("pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 1 || pending[0].Version != r.Version {
+		t.Fatalf("expected only version %d to be pending, got %#v", r.Version, pending)
+	}
+
+	r.Status = "deployed"
+	if _, err := d.Update(r); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = d.Pending("pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending releases after update, got %#v", pending)
+	}
+}
+
+func TestNewDriver(t *testing.T) {
+	if _, err := NewDriver(MemoryDriverName, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDriver(SQLDriverName, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDriver("bogus", nil); err == nil {
+		t.Error("expected an error for an unknown driver name")
+	}
+}
@@ -0,0 +1,130 @@
+package driver
+
+import (
+	"database/sql"
+
+	"github.com/satori/go.uuid"
+)
+
+// Transaction is the subset of a SQL transaction that SQLDriver needs to
+// allocate a release version and insert the release atomically.
+type Transaction interface {
+	Insert(list ...interface{}) error
+	SelectOne(holder interface{}, query string, args ...interface{}) error
+	Commit() error
+	Rollback() error
+}
+
+// DB is the subset of empire's DB type that SQLDriver needs.
+type DB interface {
+	Begin() (Transaction, error)
+	Select(list interface{}, query string, args ...interface{}) error
+	SelectOne(holder interface{}, query string, args ...interface{}) error
+	Update(list ...interface{}) (int64, error)
+}
+
+// SQLDriver is a Driver implementation backed by Postgres. It's the storage
+// backend empire uses in production.
+type SQLDriver struct {
+	DB
+}
+
+// NewSQLDriver returns a new SQLDriver backed by db.
+func NewSQLDriver(db DB) *SQLDriver {
+	return &SQLDriver{db}
+}
+
+// Create allocates the next version for r.AppID from app_release_counters
+// and inserts r, all within a single transaction so the two never diverge.
+func (d *SQLDriver) Create(r *Release) (*Release, error) {
+	t, err := d.DB.Begin()
+	if err != nil {
+		return r, err
+	}
+
+	if r.ID == "" {
+		r.ID = uuid.NewV4().String()
+	}
+
+	if err := t.SelectOne(&r.Version, `
+		insert into app_release_counters (app_id, next_version)
+		values ($1, 1)
+		on conflict (app_id) do update set next_version = app_release_counters.next_version + 1
+		returning next_version
+	`, r.AppID); err != nil {
+		t.Rollback()
+		return r, err
+	}
+
+	if err := t.Insert(r); err != nil {
+		t.Rollback()
+		return r, err
+	}
+
+	return r, t.Commit()
+}
+
+func (d *SQLDriver) Get(appID string, version int64) (*Release, error) {
+	var r Release
+
+	if err := d.DB.SelectOne(&r, `select * from releases where app_id = $1 and version = $2`, appID, version); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (d *SQLDriver) List(filter func(*Release) bool) ([]*Release, error) {
+	var rs []*Release
+	if err := d.DB.Select(&rs, `select * from releases`); err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		return rs, nil
+	}
+
+	var filtered []*Release
+	for _, r := range rs {
+		if filter(r) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered, nil
+}
+
+// Pending returns every release with the given status, pushed down as a
+// WHERE clause rather than scanning the whole table.
+func (d *SQLDriver) Pending(status string) ([]*Release, error) {
+	var rs []*Release
+	return rs, d.DB.Select(&rs, `select * from releases where status = $1`, status)
+}
+
+func (d *SQLDriver) History(appID string) ([]*Release, error) {
+	var rs []*Release
+	return rs, d.DB.Select(&rs, `select * from releases where app_id = $1 order by version desc`, appID)
+}
+
+func (d *SQLDriver) Last(appID string) (*Release, error) {
+	var r Release
+
+	if err := d.DB.SelectOne(&r, `select * from releases where app_id = $1 order by version desc limit 1`, appID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (d *SQLDriver) Update(r *Release) (*Release, error) {
+	_, err := d.DB.Update(r)
+	return r, err
+}